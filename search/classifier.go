@@ -0,0 +1,354 @@
+//  Copyright (c) 2019 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"math"
+
+	"github.com/blevesearch/bleve/document"
+	"github.com/blevesearch/bleve/index"
+)
+
+// fieldTokens returns the distinct terms produced by analyzing field, using
+// whatever tokens the field's own analyzer already extracted for indexing.
+func fieldTokens(field document.Field) map[string]struct{} {
+	terms := make(map[string]struct{})
+	for term := range field.Analyze() {
+		terms[term] = struct{}{}
+	}
+	return terms
+}
+
+// laplaceAlpha is the Laplace (add-one) smoothing constant used when
+// estimating P(term|class) from term document frequencies.
+const laplaceAlpha = 1.0
+
+// laplaceProb computes the Laplace-smoothed P(term|class) = (df+alpha) /
+// (n+alpha*vocab), given the term's document frequency df within a
+// collection of n documents drawn from a vocabulary of size vocab.
+func laplaceProb(df, n, vocab uint64) float64 {
+	return (float64(df) + laplaceAlpha) / (float64(n) + laplaceAlpha*float64(vocab))
+}
+
+// softmax normalizes logOdds (one entry per class label) into a probability
+// distribution, and reports the highest-scoring label alongside its raw
+// (pre-softmax) log-odds value.
+func softmax(logOdds map[string]float64) (probs map[string]float64, bestLabel string, bestLogOdds float64) {
+	maxLogOdds := math.Inf(-1)
+	for _, v := range logOdds {
+		if v > maxLogOdds {
+			maxLogOdds = v
+		}
+	}
+	var sumExp float64
+	for _, v := range logOdds {
+		sumExp += math.Exp(v - maxLogOdds)
+	}
+
+	probs = make(map[string]float64, len(logOdds))
+	bestLogOdds = math.Inf(-1)
+	for label, v := range logOdds {
+		probs[label] = math.Exp(v-maxLogOdds) / sumExp
+		if v > bestLogOdds {
+			bestLogOdds = v
+			bestLabel = label
+		}
+	}
+	return probs, bestLabel, bestLogOdds
+}
+
+// classifierReader is the subset of index.IndexReader that ClassModel,
+// VocabSize and ClassifierSearcher need. Any index.IndexReader satisfies it
+// automatically; declaring it narrowly here (rather than depending on the
+// full index.IndexReader) lets tests exercise the reader-consultation logic
+// with a lightweight fake instead of having to implement every method of
+// the real interface.
+type classifierReader interface {
+	TermFieldReader(term []byte, field string, includeFreq, includeNorm, includeTermVectors bool) (index.TermFieldReader, error)
+	FieldDict(field string) (index.FieldDict, error)
+	ExternalID(id index.IndexInternalID) (string, error)
+	Document(id string) (*document.Document, error)
+}
+
+// ClassModel holds the statistics needed to score a single trained class.
+// ClassField names the field under which this class's training documents
+// were indexed (so their term document frequencies can be looked up live
+// from an index.IndexReader), and NDocs is N_c, the number of documents
+// trained into the class. Callers that need the classifier to survive a
+// restart are responsible for persisting ClassModel (e.g. as JSON) and
+// reloading it before constructing a ClassifierSearcher; this package does
+// not own index storage.
+type ClassModel struct {
+	Label      string
+	ClassField string
+	NDocs      uint64
+}
+
+// termProb returns the Laplace-smoothed P(term|class), looking up the
+// term's document frequency within this class's training partition
+// directly from reader rather than any cached copy.
+func (m *ClassModel) termProb(reader classifierReader, term string, vocab uint64) (float64, error) {
+	df, err := termDocFreq(reader, term, m.ClassField)
+	if err != nil {
+		return 0, err
+	}
+	return laplaceProb(df, m.NDocs, vocab), nil
+}
+
+// termDocFreq returns the number of documents indexed under field that
+// contain term, as reported by reader.
+func termDocFreq(reader classifierReader, term, field string) (uint64, error) {
+	tfr, err := reader.TermFieldReader([]byte(term), field, false, false, false)
+	if err != nil {
+		return 0, err
+	}
+	defer tfr.Close()
+	return tfr.Count(), nil
+}
+
+// VocabSize returns the number of distinct terms indexed under field,
+// suitable as the V term in ClassModel's Laplace smoothing. Callers
+// typically compute this once (over the field their classes were trained
+// on) and pass it to NewClassifierSearcher.
+func VocabSize(reader classifierReader, field string) (uint64, error) {
+	dict, err := reader.FieldDict(field)
+	if err != nil {
+		return 0, err
+	}
+	defer dict.Close()
+
+	var v uint64
+	entry, err := dict.Next()
+	for err == nil && entry != nil {
+		v++
+		entry, err = dict.Next()
+	}
+	return v, err
+}
+
+// ClassifierSearcher is a Searcher that classifies each of a candidate set
+// of documents against a set of pretrained classes using a pseudo-Bayes
+// (Naive Bayes over term document frequencies) model, rather than standard
+// TF-IDF relevance. It is built directly with NewClassifierSearcher and does
+// not read SearcherOptions.ClassificationMode.
+//
+// For each candidate document's own terms in queryField and each class c it
+// computes the smoothed estimate
+//
+//	P(t|c) = (df_c(t) + alpha) / (N_c + alpha*V)
+//
+// from ClassModel.ClassField via the index.IndexReader, then sums the
+// per-class log-odds
+//
+//	sum_t log P(t|c) - log P(t|not c)
+//
+// DocumentMatch.Score carries the winning class's log-odds, and the softmax
+// over all classes' log-odds becomes DocumentMatch.ClassScores.
+type ClassifierSearcher struct {
+	reader     classifierReader
+	candidates index.TermFieldReader
+	queryField string
+	models     []*ClassModel
+	vocab      uint64
+
+	count uint64
+}
+
+// NewClassifierSearcher builds a ClassifierSearcher that classifies the
+// documents enumerated by candidates (typically the postings for whatever
+// terms the caller wants classified) against classes, reading each
+// candidate's own terms from queryField. vocab is the size of the reader's
+// vocabulary (see VocabSize), used as V in the Laplace smoothing term.
+func NewClassifierSearcher(reader classifierReader, candidates index.TermFieldReader,
+	queryField string, classes []*ClassModel, vocab uint64) (*ClassifierSearcher, error) {
+	return &ClassifierSearcher{
+		reader:     reader,
+		candidates: candidates,
+		queryField: queryField,
+		models:     classes,
+		vocab:      vocab,
+	}, nil
+}
+
+// docTerms returns the distinct terms doc contributes to field.
+func docTerms(doc *document.Document, field string) map[string]struct{} {
+	terms := map[string]struct{}{}
+	for _, f := range doc.Fields {
+		if f.Name() != field {
+			continue
+		}
+		for term := range fieldTokens(f) {
+			terms[term] = struct{}{}
+		}
+	}
+	return terms
+}
+
+// classifyTerms scores terms against every class in models, consulting
+// reader for each term's document frequency within (and outside of) each
+// class's training partition, and returns the per-class posterior
+// probabilities plus the winning class's log-odds.
+func classifyTerms(reader classifierReader, terms map[string]struct{}, models []*ClassModel, vocab uint64) (map[string]float64, float64, error) {
+	logOdds := make(map[string]float64, len(models))
+	for _, m := range models {
+		var logPClass, logPNotClass float64
+		for term := range terms {
+			pClass, err := m.termProb(reader, term, vocab)
+			if err != nil {
+				return nil, 0, err
+			}
+			logPClass += math.Log(pClass)
+
+			// P(term|not class) is estimated from the pooled document
+			// frequency across every other class's training partition.
+			var notDF, notDocs uint64
+			for _, other := range models {
+				if other == m {
+					continue
+				}
+				df, err := termDocFreq(reader, term, other.ClassField)
+				if err != nil {
+					return nil, 0, err
+				}
+				notDF += df
+				notDocs += other.NDocs
+			}
+			logPNotClass += math.Log(laplaceProb(notDF, notDocs, vocab))
+		}
+		logOdds[m.Label] = logPClass - logPNotClass
+	}
+
+	probs, _, bestLogOdds := softmax(logOdds)
+	return probs, bestLogOdds, nil
+}
+
+// classify scores doc's own terms in c.queryField against every trained
+// class, returning the per-class posterior probabilities plus the winning
+// class's log-odds.
+func (c *ClassifierSearcher) classify(doc *document.Document) (map[string]float64, float64, error) {
+	return classifyTerms(c.reader, docTerms(doc, c.queryField), c.models, c.vocab)
+}
+
+// match loads and classifies the document behind next, allocating the
+// returned DocumentMatch through ctx so it counts against the search's
+// memory budget.
+func (c *ClassifierSearcher) match(ctx *SearchContext, next *index.TermFieldDoc) (*DocumentMatch, error) {
+	externalID, err := c.reader.ExternalID(next.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := c.reader.Document(externalID)
+	if err != nil {
+		return nil, err
+	}
+
+	probs, logOdds, err := c.classify(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	rv, err := ctx.Allocate()
+	if err != nil {
+		return nil, err
+	}
+	rv.IndexInternalID = next.ID
+	rv.ID = externalID
+	rv.Score = logOdds
+	rv.ClassScores = probs
+
+	// ClassScores can be arbitrarily large with many trained classes;
+	// Allocate only reserved rv's baseline overhead, so account for the
+	// incremental bytes ClassScores (and anything else set above) added.
+	if err := ctx.ReserveExtra(uint64(rv.SizeInBytes() - HeapOverhead["DocumentMatch"])); err != nil {
+		return nil, err
+	}
+
+	c.count++
+	return rv, nil
+}
+
+func (c *ClassifierSearcher) Next(ctx *SearchContext) (*DocumentMatch, error) {
+	if ctx.Ctx != nil {
+		if err := ctx.Ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	next, err := c.candidates.Next(nil)
+	if err != nil || next == nil {
+		return nil, err
+	}
+	return c.match(ctx, next)
+}
+
+func (c *ClassifierSearcher) Advance(ctx *SearchContext, ID index.IndexInternalID) (*DocumentMatch, error) {
+	if ctx.Ctx != nil {
+		if err := ctx.Ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	next, err := c.candidates.Advance(ID, nil)
+	if err != nil || next == nil {
+		return nil, err
+	}
+	return c.match(ctx, next)
+}
+
+func (c *ClassifierSearcher) Close() error {
+	return c.candidates.Close()
+}
+
+func (c *ClassifierSearcher) Weight() float64 {
+	return 1.0
+}
+
+func (c *ClassifierSearcher) SetQueryNorm(float64) {}
+
+func (c *ClassifierSearcher) Count() uint64 {
+	return c.candidates.Count()
+}
+
+func (c *ClassifierSearcher) Min() int {
+	return 0
+}
+
+func (c *ClassifierSearcher) SizeInBytes() int {
+	sizeInBytes := 0
+	for _, m := range c.models {
+		sizeInBytes += len(m.Label) + len(m.ClassField) + index.SizeOfUint64
+	}
+	return sizeInBytes
+}
+
+func (c *ClassifierSearcher) DocumentMatchPoolSize() int {
+	return 1
+}
+
+// TrainClass registers label as a trained class whose training documents
+// were (or will be) indexed under classField, recording N_c, the number of
+// documents trained. Term document frequencies and the corpus vocabulary
+// are looked up live from an index.IndexReader at classification time (see
+// ClassModel.termProb and VocabSize) rather than cached here, so callers
+// must index docs through the normal Index.Index API with classField
+// populated before the returned ClassModel can be used to classify.
+func TrainClass(label, classField string, docs []document.Document) *ClassModel {
+	return &ClassModel{
+		Label:      label,
+		ClassField: classField,
+		NDocs:      uint64(len(docs)),
+	}
+}
@@ -0,0 +1,271 @@
+//  Copyright (c) 2019 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/blevesearch/bleve/document"
+	"github.com/blevesearch/bleve/index"
+)
+
+func TestLaplaceProb(t *testing.T) {
+	// df=0 should still produce a small nonzero probability, not 0.
+	got := laplaceProb(0, 10, 100)
+	want := 1.0 / (10 + 100)
+	if math.Abs(got-want) > 1e-9 {
+		t.Fatalf("laplaceProb(0, 10, 100) = %v, want %v", got, want)
+	}
+
+	// df == n (every document contains the term) should still be < 1 due
+	// to smoothing.
+	got = laplaceProb(10, 10, 100)
+	if got <= 0 || got >= 1 {
+		t.Fatalf("expected a smoothed probability strictly between 0 and 1, got %v", got)
+	}
+}
+
+func TestSoftmaxPicksHighestLogOdds(t *testing.T) {
+	logOdds := map[string]float64{
+		"spam": 2.0,
+		"ham":  -1.0,
+	}
+
+	probs, best, bestLogOdds := softmax(logOdds)
+
+	if best != "spam" {
+		t.Fatalf("expected \"spam\" to win, got %q", best)
+	}
+	if bestLogOdds != 2.0 {
+		t.Fatalf("expected bestLogOdds 2.0, got %v", bestLogOdds)
+	}
+
+	var sum float64
+	for _, p := range probs {
+		sum += p
+	}
+	if math.Abs(sum-1.0) > 1e-9 {
+		t.Fatalf("expected softmax probabilities to sum to 1, got %v", sum)
+	}
+	if probs["spam"] <= probs["ham"] {
+		t.Fatalf("expected spam's probability to exceed ham's: %v", probs)
+	}
+}
+
+func TestSoftmaxSingleClass(t *testing.T) {
+	probs, best, bestLogOdds := softmax(map[string]float64{"only": 5.0})
+	if best != "only" || bestLogOdds != 5.0 {
+		t.Fatalf("unexpected winner: %q %v", best, bestLogOdds)
+	}
+	if math.Abs(probs["only"]-1.0) > 1e-9 {
+		t.Fatalf("expected a single class to get probability 1, got %v", probs["only"])
+	}
+}
+
+// fakeClassifierReader is a minimal classifierReader backed by
+// test-supplied document frequencies and documents, so the
+// reader-consultation logic in termDocFreq/classify can be exercised
+// without a real index.
+type fakeClassifierReader struct {
+	// docFreq[field][term] is the document frequency termDocFreq should
+	// report for term within field.
+	docFreq map[string]map[string]uint64
+	docs    map[string]*document.Document
+}
+
+func (f *fakeClassifierReader) TermFieldReader(term []byte, field string,
+	includeFreq, includeNorm, includeTermVectors bool) (index.TermFieldReader, error) {
+	return &fakeTermFieldReader{count: f.docFreq[field][string(term)]}, nil
+}
+
+func (f *fakeClassifierReader) FieldDict(field string) (index.FieldDict, error) {
+	return nil, errors.New("fakeClassifierReader: FieldDict not supported")
+}
+
+func (f *fakeClassifierReader) ExternalID(id index.IndexInternalID) (string, error) {
+	return string(id), nil
+}
+
+func (f *fakeClassifierReader) Document(id string) (*document.Document, error) {
+	doc, ok := f.docs[id]
+	if !ok {
+		return nil, fmt.Errorf("fakeClassifierReader: no document %q", id)
+	}
+	return doc, nil
+}
+
+// fakeTermFieldReader reports a fixed document frequency. termDocFreq only
+// ever calls Count/Close on what TermFieldReader returns, so Next/Advance
+// are unreachable here.
+type fakeTermFieldReader struct {
+	count uint64
+}
+
+func (f *fakeTermFieldReader) Next(preAlloced *index.TermFieldDoc) (*index.TermFieldDoc, error) {
+	return nil, errors.New("fakeTermFieldReader: Next not supported")
+}
+
+func (f *fakeTermFieldReader) Advance(id index.IndexInternalID, preAlloced *index.TermFieldDoc) (*index.TermFieldDoc, error) {
+	return nil, errors.New("fakeTermFieldReader: Advance not supported")
+}
+
+func (f *fakeTermFieldReader) Count() uint64 { return f.count }
+func (f *fakeTermFieldReader) Close() error  { return nil }
+
+// fakeCandidates is an index.TermFieldReader over a fixed, ordered list of
+// postings, used to drive ClassifierSearcher.Next/Advance without a real
+// index.
+type fakeCandidates struct {
+	docs []*index.TermFieldDoc
+	pos  int
+}
+
+func (f *fakeCandidates) Next(preAlloced *index.TermFieldDoc) (*index.TermFieldDoc, error) {
+	if f.pos >= len(f.docs) {
+		return nil, nil
+	}
+	rv := f.docs[f.pos]
+	f.pos++
+	return rv, nil
+}
+
+func (f *fakeCandidates) Advance(id index.IndexInternalID, preAlloced *index.TermFieldDoc) (*index.TermFieldDoc, error) {
+	for i, d := range f.docs {
+		if string(d.ID) >= string(id) {
+			f.pos = i + 1
+			return d, nil
+		}
+	}
+	f.pos = len(f.docs)
+	return nil, nil
+}
+
+func (f *fakeCandidates) Count() uint64 { return uint64(len(f.docs)) }
+func (f *fakeCandidates) Close() error  { return nil }
+
+func TestClassifyTermsUsesReaderDocFrequencies(t *testing.T) {
+	spam := &ClassModel{Label: "spam", ClassField: "class_spam", NDocs: 10}
+	ham := &ClassModel{Label: "ham", ClassField: "class_ham", NDocs: 10}
+
+	reader := &fakeClassifierReader{
+		docFreq: map[string]map[string]uint64{
+			"class_spam": {"free": 8},
+			"class_ham":  {"free": 1},
+		},
+	}
+
+	probs, bestLogOdds, err := classifyTerms(reader, map[string]struct{}{"free": {}}, []*ClassModel{spam, ham}, 100)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if probs["spam"] <= probs["ham"] {
+		t.Fatalf("expected \"free\" (df=8 in spam vs df=1 in ham) to favor spam: %v", probs)
+	}
+	if bestLogOdds <= 0 {
+		t.Fatalf("expected a positive winning log-odds, got %v", bestLogOdds)
+	}
+
+	// Flip which class the term is common in and confirm the verdict flips
+	// too — this only holds if termProb is actually consulting reader's doc
+	// frequencies live, rather than some cached copy computed once up front.
+	reader.docFreq["class_spam"]["free"] = 1
+	reader.docFreq["class_ham"]["free"] = 8
+	probs, _, err = classifyTerms(reader, map[string]struct{}{"free": {}}, []*ClassModel{spam, ham}, 100)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if probs["ham"] <= probs["spam"] {
+		t.Fatalf("expected the verdict to flip once reader's doc frequencies did: %v", probs)
+	}
+}
+
+func TestClassifierSearcherNextSetsDocumentIdentity(t *testing.T) {
+	spam := &ClassModel{Label: "spam", ClassField: "class_spam", NDocs: 10}
+	ham := &ClassModel{Label: "ham", ClassField: "class_ham", NDocs: 10}
+
+	reader := &fakeClassifierReader{
+		docFreq: map[string]map[string]uint64{},
+		docs: map[string]*document.Document{
+			"doc1": {ID: "doc1"},
+			"doc2": {ID: "doc2"},
+		},
+	}
+	candidates := &fakeCandidates{docs: []*index.TermFieldDoc{
+		{ID: index.IndexInternalID("doc1")},
+		{ID: index.IndexInternalID("doc2")},
+	}}
+
+	cs, err := NewClassifierSearcher(reader, candidates, "body", []*ClassModel{spam, ham}, 100)
+	if err != nil {
+		t.Fatalf("NewClassifierSearcher: %v", err)
+	}
+	ctx := &SearchContext{DocumentMatchPool: NewDocumentMatchPool(0, 0)}
+
+	first, err := cs.Next(ctx)
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	if first == nil || first.ID != "doc1" || string(first.IndexInternalID) != "doc1" {
+		t.Fatalf("expected the first match to carry doc1's identity, got %+v", first)
+	}
+	if first.ClassScores == nil {
+		t.Fatalf("expected ClassScores to be populated")
+	}
+
+	second, err := cs.Next(ctx)
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	if second == nil || second.ID != "doc2" {
+		t.Fatalf("expected the second match to carry doc2's identity, got %+v", second)
+	}
+
+	third, err := cs.Next(ctx)
+	if err != nil || third != nil {
+		t.Fatalf("expected no more matches, got %+v (err=%v)", third, err)
+	}
+}
+
+func TestClassifierSearcherAdvanceSeeksCandidates(t *testing.T) {
+	spam := &ClassModel{Label: "spam", ClassField: "class_spam", NDocs: 10}
+
+	reader := &fakeClassifierReader{
+		docFreq: map[string]map[string]uint64{},
+		docs: map[string]*document.Document{
+			"doc3": {ID: "doc3"},
+		},
+	}
+	candidates := &fakeCandidates{docs: []*index.TermFieldDoc{
+		{ID: index.IndexInternalID("doc1")},
+		{ID: index.IndexInternalID("doc3")},
+	}}
+
+	cs, err := NewClassifierSearcher(reader, candidates, "body", []*ClassModel{spam}, 100)
+	if err != nil {
+		t.Fatalf("NewClassifierSearcher: %v", err)
+	}
+	ctx := &SearchContext{DocumentMatchPool: NewDocumentMatchPool(0, 0)}
+
+	match, err := cs.Advance(ctx, index.IndexInternalID("doc2"))
+	if err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+	if match == nil || match.ID != "doc3" {
+		t.Fatalf("expected Advance to seek to doc3, got %+v", match)
+	}
+}
@@ -0,0 +1,246 @@
+//  Copyright (c) 2019 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"container/heap"
+	"fmt"
+
+	"github.com/blevesearch/bleve/index"
+)
+
+// groupHeap is a min-heap of *DocumentMatch ordered by Score, used to keep
+// only the top GroupLimit hits seen so far for a single group.
+type groupHeap []*DocumentMatch
+
+func (h groupHeap) Len() int            { return len(h) }
+func (h groupHeap) Less(i, j int) bool  { return h[i].Score < h[j].Score }
+func (h groupHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *groupHeap) Push(x interface{}) { *h = append(*h, x.(*DocumentMatch)) }
+func (h *groupHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// groupingReader is the subset of index.IndexReader that GroupingSearcher
+// needs — doc-value access for the GroupBy field. Any index.IndexReader
+// satisfies it automatically; declaring it narrowly here lets tests supply
+// a lightweight fake instead of the full index.IndexReader.
+type groupingReader interface {
+	DocValueReader(fields []string) (index.DocValueReader, error)
+}
+
+// GroupingSearcher wraps a child Searcher and collapses its results by the
+// doc-value field named SearcherOptions.GroupBy, emitting one representative
+// (highest-scoring) DocumentMatch per distinct field value, analogous to
+// Solr's field collapsing or Lucene's GroupingSearch. Up to
+// SearcherOptions.GroupLimit of the remaining top hits in a group are
+// retained on the representative's GroupHits.
+//
+// A top-level GroupedCollector that coordinates per-group buffers with
+// DocumentMatchPool across multiple GroupingSearchers belongs in
+// search/collector, which does not exist in this tree; GroupingSearcher's
+// own per-group heaps below are the extent of the buffering implemented
+// here.
+type GroupingSearcher struct {
+	child    Searcher
+	reader   groupingReader
+	dvReader index.DocValueReader
+	options  SearcherOptions
+
+	groups    map[string]*groupHeap
+	order     []string
+	pos       int
+	collected bool
+}
+
+// NewGroupingSearcher wraps child, grouping its hits by options.GroupBy. The
+// child is drained during the first call to Next, so GroupingSearcher's
+// DocumentMatchPool usage is bounded by the number of distinct groups rather
+// than the number of underlying hits. The doc-value column reader for
+// options.GroupBy is built once, up front, since it is the expensive part
+// of doc-value access and every hit needs it.
+func NewGroupingSearcher(reader groupingReader, child Searcher,
+	options SearcherOptions) (*GroupingSearcher, error) {
+	dvReader, err := reader.DocValueReader([]string{options.GroupBy})
+	if err != nil {
+		return nil, err
+	}
+
+	return &GroupingSearcher{
+		child:    child,
+		reader:   reader,
+		dvReader: dvReader,
+		options:  options,
+		groups:   make(map[string]*groupHeap),
+	}, nil
+}
+
+// groupKey looks up the value of options.GroupBy for id using the reader's
+// doc-value support, returning "" if the field has no value for this doc.
+func (g *GroupingSearcher) groupKey(id index.IndexInternalID) (string, error) {
+	var key string
+	err := g.dvReader.VisitDocValues(id, func(field string, term []byte) {
+		if field == g.options.GroupBy && key == "" {
+			key = string(term)
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// collect drains the child searcher, bucketing each hit into its group's
+// bounded heap, keeping at most GroupLimit+1 hits (the representative plus
+// GroupLimit group hits) per group.
+func (g *GroupingSearcher) collect(ctx *SearchContext) error {
+	capacity := g.options.GroupLimit + 1
+
+	match, err := g.child.Next(ctx)
+	for err == nil && match != nil {
+		if ctx.Ctx != nil {
+			if cerr := ctx.Ctx.Err(); cerr != nil {
+				return cerr
+			}
+		}
+
+		key, kerr := g.groupKey(match.IndexInternalID)
+		if kerr != nil {
+			return kerr
+		}
+
+		h, ok := g.groups[key]
+		if !ok {
+			gh := make(groupHeap, 0, capacity)
+			h = &gh
+			g.groups[key] = h
+			g.order = append(g.order, key)
+		}
+
+		if h.Len() < capacity {
+			heap.Push(h, match)
+		} else if (*h)[0].Score < match.Score {
+			evicted := heap.Pop(h).(*DocumentMatch)
+			ctx.Recycle(evicted)
+			heap.Push(h, match)
+		} else {
+			// match didn't beat this group's current minimum, so it's never
+			// retained; give back the memory Next/Advance reserved for it.
+			ctx.Recycle(match)
+		}
+
+		match, err = g.child.Next(ctx)
+	}
+	return err
+}
+
+func (g *GroupingSearcher) Next(ctx *SearchContext) (*DocumentMatch, error) {
+	if !g.collected {
+		g.collected = true
+		if err := g.collect(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if g.pos >= len(g.order) {
+		return nil, nil
+	}
+	key := g.order[g.pos]
+	g.pos++
+
+	h := *g.groups[key]
+	if len(h) == 0 {
+		return g.Next(ctx)
+	}
+
+	// the heap is ordered smallest-score-first; the representative is the
+	// highest scoring hit, the rest become GroupHits.
+	best := 0
+	for i, dm := range h {
+		if dm.Score > h[best].Score {
+			best = i
+		}
+	}
+
+	rep := h[best]
+	rep.GroupKey = key
+	for i, dm := range h {
+		if i != best {
+			rep.GroupHits = append(rep.GroupHits, dm)
+		}
+	}
+
+	return rep, nil
+}
+
+// Advance is intentionally unsupported: GroupingSearcher's output is ordered
+// by group, not by IndexInternalID, so there is no well-defined hit to seek
+// to for an arbitrary ID. Silently falling back to Next would let a caller
+// that composes this searcher under an intersection/union (which rely on
+// Advance to stay in lock-step with a driving ID) desync without any
+// indication something went wrong. Failing loudly here is preferable to a
+// child searcher reaching a different document than its siblings believe it
+// did.
+func (g *GroupingSearcher) Advance(ctx *SearchContext, ID index.IndexInternalID) (*DocumentMatch, error) {
+	return nil, fmt.Errorf("search: GroupingSearcher does not support Advance (grouped output is not ordered by IndexInternalID)")
+}
+
+func (g *GroupingSearcher) Close() error {
+	return g.child.Close()
+}
+
+func (g *GroupingSearcher) Weight() float64 {
+	return g.child.Weight()
+}
+
+func (g *GroupingSearcher) SetQueryNorm(qnorm float64) {
+	g.child.SetQueryNorm(qnorm)
+}
+
+// Count returns the number of distinct groups collected so far. Grouping
+// only happens lazily, on the first call to Next, so before that it falls
+// back to g.child.Count() — an upper bound on the eventual number of groups
+// (at most one per underlying hit) — rather than reporting 0 to a caller
+// that consults Count() up front for sizing, as is conventional elsewhere in
+// this package.
+func (g *GroupingSearcher) Count() uint64 {
+	if !g.collected {
+		return g.child.Count()
+	}
+	return uint64(len(g.groups))
+}
+
+func (g *GroupingSearcher) Min() int {
+	return g.child.Min()
+}
+
+func (g *GroupingSearcher) SizeInBytes() int {
+	sizeInBytes := g.child.SizeInBytes()
+	for k, h := range g.groups {
+		sizeInBytes += len(k) + index.SizeOfString
+		for _, dm := range *h {
+			sizeInBytes += dm.SizeInBytes()
+		}
+	}
+	return sizeInBytes
+}
+
+func (g *GroupingSearcher) DocumentMatchPoolSize() int {
+	return g.child.DocumentMatchPoolSize()
+}
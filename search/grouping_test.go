@@ -0,0 +1,244 @@
+//  Copyright (c) 2019 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"container/heap"
+	"fmt"
+	"testing"
+
+	"github.com/blevesearch/bleve/index"
+)
+
+func TestGroupHeapKeepsOnlyTopN(t *testing.T) {
+	capacity := 3
+	h := make(groupHeap, 0, capacity)
+
+	scores := []float64{5, 1, 9, 3, 7, 2, 8}
+	for _, s := range scores {
+		dm := &DocumentMatch{Score: s}
+		if h.Len() < capacity {
+			heap.Push(&h, dm)
+		} else if h[0].Score < dm.Score {
+			heap.Pop(&h)
+			heap.Push(&h, dm)
+		}
+	}
+
+	if h.Len() != capacity {
+		t.Fatalf("expected %d entries retained, got %d", capacity, h.Len())
+	}
+
+	got := map[float64]bool{}
+	for _, dm := range h {
+		got[dm.Score] = true
+	}
+	for _, want := range []float64{9, 8, 7} {
+		if !got[want] {
+			t.Fatalf("expected the top-3 scores {9,8,7} to survive eviction, got %v", h)
+		}
+	}
+}
+
+func TestGroupHeapMinIsAlwaysEvictedFirst(t *testing.T) {
+	h := &groupHeap{
+		{Score: 3},
+		{Score: 1},
+		{Score: 2},
+	}
+	heap.Init(h)
+
+	popped := heap.Pop(h).(*DocumentMatch)
+	if popped.Score != 1 {
+		t.Fatalf("expected the minimum score (1) to pop first, got %v", popped.Score)
+	}
+}
+
+// fakeGroupingReader is a minimal groupingReader whose DocValueReader
+// reports a fixed group key per doc, keyed by IndexInternalID, so
+// GroupingSearcher's collection logic can be exercised without a real
+// index.
+type fakeGroupingReader struct {
+	keys map[string]string
+}
+
+func (f *fakeGroupingReader) DocValueReader(fields []string) (index.DocValueReader, error) {
+	return &fakeDocValueReader{keys: f.keys}, nil
+}
+
+type fakeDocValueReader struct {
+	keys map[string]string
+}
+
+func (f *fakeDocValueReader) VisitDocValues(id index.IndexInternalID, visitor func(field string, term []byte)) error {
+	visitor("group", []byte(f.keys[string(id)]))
+	return nil
+}
+
+// fakeGroupChild is a Searcher whose Next replays a fixed, ordered list of
+// matches (allocated through ctx like a real Searcher would), used to drive
+// GroupingSearcher.collect without a real index.
+type fakeGroupChild struct {
+	matches []*DocumentMatch
+	pos     int
+}
+
+func (f *fakeGroupChild) Next(ctx *SearchContext) (*DocumentMatch, error) {
+	if f.pos >= len(f.matches) {
+		return nil, nil
+	}
+	m, err := ctx.Allocate()
+	if err != nil {
+		return nil, err
+	}
+	*m = *f.matches[f.pos]
+	f.pos++
+	return m, nil
+}
+
+func (f *fakeGroupChild) Advance(ctx *SearchContext, ID index.IndexInternalID) (*DocumentMatch, error) {
+	return nil, fmt.Errorf("fakeGroupChild: Advance not supported")
+}
+
+func (f *fakeGroupChild) Close() error               { return nil }
+func (f *fakeGroupChild) Weight() float64            { return 1.0 }
+func (f *fakeGroupChild) SetQueryNorm(float64)       {}
+func (f *fakeGroupChild) Count() uint64              { return uint64(len(f.matches)) }
+func (f *fakeGroupChild) Min() int                   { return 0 }
+func (f *fakeGroupChild) SizeInBytes() int           { return 0 }
+func (f *fakeGroupChild) DocumentMatchPoolSize() int { return 1 }
+
+func TestGroupingSearcherKeepsHighestScorePerGroup(t *testing.T) {
+	child := &fakeGroupChild{matches: []*DocumentMatch{
+		{IndexInternalID: index.IndexInternalID("a1"), Score: 1},
+		{IndexInternalID: index.IndexInternalID("b1"), Score: 5},
+		{IndexInternalID: index.IndexInternalID("a2"), Score: 9},
+		{IndexInternalID: index.IndexInternalID("b2"), Score: 2},
+	}}
+	reader := &fakeGroupingReader{keys: map[string]string{
+		"a1": "a", "a2": "a", "b1": "b", "b2": "b",
+	}}
+
+	g, err := NewGroupingSearcher(reader, child, SearcherOptions{GroupBy: "group", GroupLimit: 1})
+	if err != nil {
+		t.Fatalf("NewGroupingSearcher: %v", err)
+	}
+	ctx := &SearchContext{DocumentMatchPool: NewDocumentMatchPool(4, 0)}
+
+	var got []*DocumentMatch
+	for {
+		m, err := g.Next(ctx)
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		if m == nil {
+			break
+		}
+		got = append(got, m)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("expected one representative per group, got %d", len(got))
+	}
+	for _, rep := range got {
+		switch rep.GroupKey {
+		case "a":
+			if rep.Score != 9 {
+				t.Fatalf("expected group \"a\"'s representative to be the score-9 hit, got %v", rep.Score)
+			}
+			if len(rep.GroupHits) != 1 || rep.GroupHits[0].Score != 1 {
+				t.Fatalf("expected group \"a\" to retain the score-1 hit as a GroupHit, got %v", rep.GroupHits)
+			}
+		case "b":
+			if rep.Score != 5 {
+				t.Fatalf("expected group \"b\"'s representative to be the score-5 hit, got %v", rep.Score)
+			}
+		default:
+			t.Fatalf("unexpected group key %q", rep.GroupKey)
+		}
+	}
+}
+
+func TestGroupingSearcherRecyclesDiscardedMatches(t *testing.T) {
+	const n = 1000
+	matches := make([]*DocumentMatch, n)
+	keys := map[string]string{}
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("doc%d", i)
+		matches[i] = &DocumentMatch{IndexInternalID: index.IndexInternalID(id), Score: float64(i)}
+		keys[id] = "only"
+	}
+	child := &fakeGroupChild{matches: matches}
+	reader := &fakeGroupingReader{keys: keys}
+
+	g, err := NewGroupingSearcher(reader, child, SearcherOptions{GroupBy: "group", GroupLimit: 0})
+	if err != nil {
+		t.Fatalf("NewGroupingSearcher: %v", err)
+	}
+
+	tracker := NewMemTracker()
+	// A budget that only a handful of live matches could ever fit in: with
+	// GroupLimit 0, at most one match per group is ever retained, so if
+	// discarded/evicted matches are actually recycled back to tracker, this
+	// is enough headroom for all n hits to flow through collect without
+	// tripping the limit.
+	tracker.SetLimit(uint64(4 * HeapOverhead["DocumentMatch"]))
+	ctx := &SearchContext{DocumentMatchPool: NewDocumentMatchPool(4, 0), MemTracker: tracker}
+
+	if _, err := g.Next(ctx); err != nil {
+		t.Fatalf("expected collect to recycle discarded/evicted matches and stay within budget, got: %v", err)
+	}
+}
+
+func TestGroupingSearcherAdvanceFailsLoudly(t *testing.T) {
+	child := &fakeGroupChild{}
+	reader := &fakeGroupingReader{keys: map[string]string{}}
+
+	g, err := NewGroupingSearcher(reader, child, SearcherOptions{GroupBy: "group"})
+	if err != nil {
+		t.Fatalf("NewGroupingSearcher: %v", err)
+	}
+	ctx := &SearchContext{DocumentMatchPool: NewDocumentMatchPool(1, 0)}
+
+	if _, err := g.Advance(ctx, index.IndexInternalID("a1")); err == nil {
+		t.Fatalf("expected GroupingSearcher.Advance to return an error rather than silently falling back to Next")
+	}
+}
+
+func TestGroupingSearcherCountBeforeAndAfterCollection(t *testing.T) {
+	child := &fakeGroupChild{matches: []*DocumentMatch{
+		{IndexInternalID: index.IndexInternalID("a1"), Score: 1},
+		{IndexInternalID: index.IndexInternalID("b1"), Score: 2},
+	}}
+	reader := &fakeGroupingReader{keys: map[string]string{"a1": "a", "b1": "b"}}
+
+	g, err := NewGroupingSearcher(reader, child, SearcherOptions{GroupBy: "group"})
+	if err != nil {
+		t.Fatalf("NewGroupingSearcher: %v", err)
+	}
+
+	if got, want := g.Count(), child.Count(); got != want {
+		t.Fatalf("expected Count() to fall back to the child's count before collection, got %d want %d", got, want)
+	}
+
+	ctx := &SearchContext{DocumentMatchPool: NewDocumentMatchPool(2, 0)}
+	if _, err := g.Next(ctx); err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+
+	if got, want := g.Count(), uint64(2); got != want {
+		t.Fatalf("expected Count() to report the distinct group count after collection, got %d want %d", got, want)
+	}
+}
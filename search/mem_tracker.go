@@ -14,10 +14,23 @@
 
 package search
 
-import ()
+import (
+	"errors"
+	"sync/atomic"
+)
 
+// ErrSearchMemLimitExceeded is returned by Searcher.Next/Advance once the
+// memory accounted for by a search's MemTracker (DocumentMatch, Location and
+// Explanation allocations) would cross the budget set with SetLimit.
+var ErrSearchMemLimitExceeded = errors.New("memory limit exceeded for search")
+
+// MemTracker accounts for the memory allocated on behalf of a single search,
+// optionally enforcing a hard byte budget. The zero value tracks usage with
+// no limit. A MemTracker is shared by every Searcher hanging off the same
+// SearchContext, so all of its methods are safe for concurrent use.
 type MemTracker struct {
-	bytes uint64
+	bytes uint64 // updated atomically
+	limit uint64 // updated atomically, 0 means unbounded
 }
 
 func NewMemTracker() *MemTracker {
@@ -25,9 +38,60 @@ func NewMemTracker() *MemTracker {
 }
 
 func (m *MemTracker) Add(add uint64) {
-	m.bytes += add
+	atomic.AddUint64(&m.bytes, add)
 }
 
 func (m *MemTracker) Usage() uint64 {
-	return m.bytes
+	return atomic.LoadUint64(&m.bytes)
+}
+
+// SetLimit sets the byte budget for this search. A limit of 0 means
+// unbounded, which is also the zero-value behavior.
+func (m *MemTracker) SetLimit(limit uint64) {
+	atomic.StoreUint64(&m.limit, limit)
+}
+
+// Limit returns the currently configured byte budget, or 0 if unbounded.
+func (m *MemTracker) Limit() uint64 {
+	return atomic.LoadUint64(&m.limit)
+}
+
+// Reserve accounts for delta additional bytes against the tracker's budget.
+// If the reservation would cross the configured limit, none of delta is
+// counted and ErrSearchMemLimitExceeded is returned so the caller (typically
+// SearchContext.Allocate or ReserveExtra, on behalf of a Searcher's
+// Next/Advance) can short-circuit.
+func (m *MemTracker) Reserve(delta uint64) error {
+	limit := atomic.LoadUint64(&m.limit)
+	if limit == 0 {
+		atomic.AddUint64(&m.bytes, delta)
+		return nil
+	}
+
+	for {
+		cur := atomic.LoadUint64(&m.bytes)
+		next := cur + delta
+		if next > limit {
+			return ErrSearchMemLimitExceeded
+		}
+		if atomic.CompareAndSwapUint64(&m.bytes, cur, next) {
+			return nil
+		}
+	}
+}
+
+// Release gives back delta bytes previously accounted for with Reserve or
+// Add. SearchContext.Recycle calls this for a DocumentMatch's current
+// SizeInBytes() as it returns the match to the DocumentMatchPool.
+func (m *MemTracker) Release(delta uint64) {
+	for {
+		cur := atomic.LoadUint64(&m.bytes)
+		next := cur - delta
+		if delta > cur {
+			next = 0
+		}
+		if atomic.CompareAndSwapUint64(&m.bytes, cur, next) {
+			return
+		}
+	}
 }
@@ -0,0 +1,116 @@
+//  Copyright (c) 2019 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestMemTrackerUnboundedByDefault(t *testing.T) {
+	m := NewMemTracker()
+	if err := m.Reserve(1 << 40); err != nil {
+		t.Fatalf("expected no limit to allow any reservation, got %v", err)
+	}
+	if got := m.Usage(); got != 1<<40 {
+		t.Fatalf("expected usage %d, got %d", uint64(1)<<40, got)
+	}
+}
+
+func TestMemTrackerReserveRespectsLimit(t *testing.T) {
+	m := NewMemTracker()
+	m.SetLimit(100)
+
+	if err := m.Reserve(60); err != nil {
+		t.Fatalf("unexpected error reserving under budget: %v", err)
+	}
+	if err := m.Reserve(41); err != ErrSearchMemLimitExceeded {
+		t.Fatalf("expected ErrSearchMemLimitExceeded, got %v", err)
+	}
+	// the failed reservation must not have been partially counted
+	if got := m.Usage(); got != 60 {
+		t.Fatalf("expected usage to remain 60 after a rejected reservation, got %d", got)
+	}
+
+	if err := m.Reserve(40); err != nil {
+		t.Fatalf("unexpected error reserving exactly up to the limit: %v", err)
+	}
+	if got := m.Usage(); got != 100 {
+		t.Fatalf("expected usage 100, got %d", got)
+	}
+}
+
+func TestMemTrackerRelease(t *testing.T) {
+	m := NewMemTracker()
+	m.SetLimit(100)
+
+	if err := m.Reserve(100); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m.Release(30)
+	if got := m.Usage(); got != 70 {
+		t.Fatalf("expected usage 70 after release, got %d", got)
+	}
+
+	// releasing more than is currently tracked should clamp to zero, not
+	// underflow the unsigned counter
+	m.Release(1000)
+	if got := m.Usage(); got != 0 {
+		t.Fatalf("expected usage to clamp at 0, got %d", got)
+	}
+
+	if err := m.Reserve(100); err != nil {
+		t.Fatalf("unexpected error reserving after release: %v", err)
+	}
+}
+
+// TestMemTrackerReserveConcurrent hammers Reserve from many goroutines at
+// once to catch the classic CAS-loop bug where a lost race lets the total
+// creep past the configured limit. Run with -race to also catch any data
+// race in the atomic bookkeeping.
+func TestMemTrackerReserveConcurrent(t *testing.T) {
+	m := NewMemTracker()
+	const limit = 1000
+	m.SetLimit(limit)
+
+	const goroutines = 50
+	const perGoroutine = 100 // 50*100 = 5000, far more than the budget allows
+
+	var wg sync.WaitGroup
+	var succeeded uint64
+	var mu sync.Mutex
+
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perGoroutine; j++ {
+				if err := m.Reserve(1); err == nil {
+					mu.Lock()
+					succeeded++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if succeeded != limit {
+		t.Fatalf("expected exactly %d successful reservations, got %d", limit, succeeded)
+	}
+	if got := m.Usage(); got != limit {
+		t.Fatalf("expected final usage %d, got %d", limit, got)
+	}
+}
@@ -0,0 +1,72 @@
+//  Copyright (c) 2019 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+// DocumentMatchPool manages a pool of pre-allocated DocumentMatch instances
+// so a Searcher tree can hand out and reclaim matches without round-tripping
+// through the allocator on every hit.
+type DocumentMatchPool struct {
+	avail DocumentMatchCollection
+	arena DocumentMatchCollection
+}
+
+// NewDocumentMatchPool allocates a pool of size DocumentMatch instances,
+// each with its Sort slice pre-sized to backingSize (0 to skip
+// pre-sizing).
+func NewDocumentMatchPool(size, backingSize int) *DocumentMatchPool {
+	if size <= 0 {
+		return &DocumentMatchPool{}
+	}
+
+	avail := make(DocumentMatchCollection, size)
+	arena := make(DocumentMatchCollection, size)
+	for i := 0; i < size; i++ {
+		arena[i] = &DocumentMatch{}
+		if backingSize > 0 {
+			arena[i].Sort = make([]string, 0, backingSize)
+		}
+		avail[i] = arena[i]
+	}
+
+	return &DocumentMatchPool{
+		avail: avail,
+		arena: arena,
+	}
+}
+
+// Get returns a *DocumentMatch from the pool, falling back to a fresh
+// allocation once the pool is exhausted.
+func (p *DocumentMatchPool) Get() *DocumentMatch {
+	var rv *DocumentMatch
+	if len(p.avail) > 0 {
+		rv = p.avail[len(p.avail)-1]
+		p.avail = p.avail[:len(p.avail)-1]
+	} else {
+		rv = &DocumentMatch{}
+	}
+	return rv
+}
+
+// Put returns d to the pool for reuse, resetting it first. It is a no-op for
+// a nil DocumentMatch. Put itself has no opinion on a search's memory
+// budget; callers that obtained d from a SearchContext's Allocate should go
+// through SearchContext.Recycle instead of calling Put directly, so the
+// memory Allocate reserved is released back to the MemTracker.
+func (p *DocumentMatchPool) Put(d *DocumentMatch) {
+	if d == nil {
+		return
+	}
+	p.avail = append(p.avail, d.Reset())
+}
@@ -0,0 +1,60 @@
+//  Copyright (c) 2019 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import "testing"
+
+func TestDocumentMatchPoolReusesPutMatches(t *testing.T) {
+	p := NewDocumentMatchPool(2, 0)
+
+	a := p.Get()
+	b := p.Get()
+	if a == b {
+		t.Fatalf("expected distinct matches from a fresh pool")
+	}
+
+	a.Score = 1.23
+	p.Put(a)
+
+	c := p.Get()
+	if c != a {
+		t.Fatalf("expected Get to hand back the instance just Put")
+	}
+	if c.Score != 0 {
+		t.Fatalf("expected Put to Reset the match, got Score=%v", c.Score)
+	}
+
+	_ = b
+}
+
+func TestDocumentMatchPoolFallsBackWhenExhausted(t *testing.T) {
+	p := NewDocumentMatchPool(1, 0)
+
+	first := p.Get()
+	second := p.Get()
+	if first == nil || second == nil {
+		t.Fatalf("Get should never return nil")
+	}
+	if first == second {
+		t.Fatalf("expected a fresh allocation once the pool is exhausted")
+	}
+}
+
+func TestDocumentMatchPoolZeroSize(t *testing.T) {
+	p := NewDocumentMatchPool(0, 0)
+	if p.Get() == nil {
+		t.Fatalf("Get should never return nil, even for a zero-sized pool")
+	}
+}
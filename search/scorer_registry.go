@@ -0,0 +1,127 @@
+//  Copyright (c) 2019 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import "math"
+
+// TermScorer computes the contribution of a single term match to a
+// document's score. TermQuerySearcher and PhraseSearcher are meant to
+// consult the registry below to pick an implementation based on
+// SearcherOptions.ScoringModel, falling back to the package's built-in
+// TF-IDF scoring when no model is registered under that name; neither of
+// those searchers exists in this tree, so ScorerForOptions has no caller
+// here yet and this registry only becomes reachable once they're added.
+type TermScorer interface {
+	// Score returns the term's contribution to the document's score, and
+	// when explain is true, a breakdown of how that score was derived.
+	//
+	// termFreq is the number of occurrences of the term in this document,
+	// docFreq the number of documents containing the term, totalDocs the
+	// number of documents in the collection, docLength the length (in
+	// terms) of this document's field, and avgDocLength the average field
+	// length across the collection.
+	Score(termFreq, docFreq, totalDocs, docLength uint64, avgDocLength float64,
+		explain bool) (float64, *Explanation)
+}
+
+// ScorerFactory builds a TermScorer configured with the given tuning
+// parameters (e.g. BM25's "k1" and "b").
+type ScorerFactory func(params map[string]float64) TermScorer
+
+var scorerRegistry = map[string]ScorerFactory{}
+
+// RegisterScorer makes a TermScorer implementation available under name for
+// use as SearcherOptions.ScoringModel. It is typically called from an init
+// function in the package providing the scorer.
+func RegisterScorer(name string, factory ScorerFactory) {
+	scorerRegistry[name] = factory
+}
+
+// ScorerForOptions looks up the TermScorer registered for
+// options.ScoringModel, returning false if no scorer is registered under
+// that name (including the empty string), in which case the caller should
+// fall back to its default scoring.
+func ScorerForOptions(options SearcherOptions) (TermScorer, bool) {
+	factory, ok := scorerRegistry[options.ScoringModel]
+	if !ok {
+		return nil, false
+	}
+	return factory(options.ScoringParams), true
+}
+
+func init() {
+	RegisterScorer("bm25", newBM25Scorer)
+}
+
+// bm25Scorer implements Okapi BM25 term scoring using the standard k1/b
+// tuning parameters.
+type bm25Scorer struct {
+	k1 float64
+	b  float64
+}
+
+// defaultBM25K1 and defaultBM25B match the values conventionally used by
+// Lucene and Elasticsearch.
+const (
+	defaultBM25K1 = 1.2
+	defaultBM25B  = 0.75
+)
+
+func newBM25Scorer(params map[string]float64) TermScorer {
+	s := &bm25Scorer{k1: defaultBM25K1, b: defaultBM25B}
+	if k1, ok := params["k1"]; ok {
+		s.k1 = k1
+	}
+	if b, ok := params["b"]; ok {
+		s.b = b
+	}
+	return s
+}
+
+func (s *bm25Scorer) Score(termFreq, docFreq, totalDocs, docLength uint64,
+	avgDocLength float64, explain bool) (float64, *Explanation) {
+	tf := float64(termFreq)
+	dl := float64(docLength)
+
+	// An empty index (or an index whose only fields are empty) has no
+	// meaningful average document length; normalizing by it would produce
+	// +Inf/NaN scores instead of a usable fallback, so skip the length
+	// normalization term entirely in that case.
+	lengthNorm := 0.0
+	if avgDocLength > 0 {
+		lengthNorm = s.b * dl / avgDocLength
+	}
+
+	idf := math.Log(1 + (float64(totalDocs)-float64(docFreq)+0.5)/(float64(docFreq)+0.5))
+	norm := s.k1 * (1 - s.b + lengthNorm)
+	score := idf * ((s.k1 + 1) * tf) / (tf + norm)
+
+	if !explain {
+		return score, nil
+	}
+
+	return score, &Explanation{
+		Value:   score,
+		Message: "bm25(idf * ((k1+1)*tf) / (tf + k1*(1-b+b*dl/avgdl)))",
+		Children: []*Explanation{
+			{Value: idf, Message: "idf, computed from docFreq and totalDocs"},
+			{Value: tf, Message: "tf, raw term frequency in this document"},
+			{Value: s.k1, Message: "k1, term frequency saturation parameter"},
+			{Value: s.b, Message: "b, document length normalization parameter"},
+			{Value: dl, Message: "dl, length of this document's field"},
+			{Value: avgDocLength, Message: "avgdl, average field length across the collection"},
+		},
+	}
+}
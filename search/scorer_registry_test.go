@@ -0,0 +1,83 @@
+//  Copyright (c) 2019 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"math"
+	"testing"
+)
+
+func TestScorerForOptionsFallsBackWhenUnregistered(t *testing.T) {
+	if _, ok := ScorerForOptions(SearcherOptions{}); ok {
+		t.Fatalf("expected no scorer registered for the empty ScoringModel")
+	}
+	if _, ok := ScorerForOptions(SearcherOptions{ScoringModel: "nonexistent"}); ok {
+		t.Fatalf("expected no scorer registered for an unknown ScoringModel")
+	}
+}
+
+func TestScorerForOptionsBM25UsesDefaultsAndOverrides(t *testing.T) {
+	scorer, ok := ScorerForOptions(SearcherOptions{ScoringModel: "bm25"})
+	if !ok {
+		t.Fatalf("expected bm25 to be registered")
+	}
+	bm25, ok := scorer.(*bm25Scorer)
+	if !ok {
+		t.Fatalf("expected *bm25Scorer, got %T", scorer)
+	}
+	if bm25.k1 != defaultBM25K1 || bm25.b != defaultBM25B {
+		t.Fatalf("expected default k1/b, got k1=%v b=%v", bm25.k1, bm25.b)
+	}
+
+	scorer, _ = ScorerForOptions(SearcherOptions{
+		ScoringModel:  "bm25",
+		ScoringParams: map[string]float64{"k1": 2.0, "b": 0.5},
+	})
+	bm25 = scorer.(*bm25Scorer)
+	if bm25.k1 != 2.0 || bm25.b != 0.5 {
+		t.Fatalf("expected overridden k1=2.0 b=0.5, got k1=%v b=%v", bm25.k1, bm25.b)
+	}
+}
+
+func TestBM25ScoreIncreasesWithTermFrequency(t *testing.T) {
+	s := newBM25Scorer(nil)
+
+	low, _ := s.Score(1, 10, 1000, 100, 120, false)
+	high, _ := s.Score(5, 10, 1000, 100, 120, false)
+	if high <= low {
+		t.Fatalf("expected score to increase with term frequency: low=%v high=%v", low, high)
+	}
+}
+
+func TestBM25ScoreZeroAvgDocLengthDoesNotBlowUp(t *testing.T) {
+	s := newBM25Scorer(nil)
+
+	score, _ := s.Score(3, 10, 1000, 50, 0, false)
+	if math.IsInf(score, 0) || math.IsNaN(score) {
+		t.Fatalf("expected a finite score when avgDocLength is 0, got %v", score)
+	}
+}
+
+func TestBM25ScoreExplainBreaksDownFactors(t *testing.T) {
+	s := newBM25Scorer(nil)
+
+	_, expl := s.Score(2, 10, 1000, 100, 120, true)
+	if expl == nil {
+		t.Fatalf("expected an Explanation when explain=true")
+	}
+	if len(expl.Children) == 0 {
+		t.Fatalf("expected the BM25 explanation to break down its factors")
+	}
+}
@@ -15,6 +15,7 @@
 package search
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 
@@ -122,6 +123,22 @@ type DocumentMatch struct {
 
 	// used to maintain natural index order
 	HitNumber uint64 `json:"-"`
+
+	// ClassScores holds the per-class probabilities computed by a
+	// ClassifierSearcher, keyed by class label. ClassifierSearcher always
+	// populates it, whatever SearcherOptions.ClassificationMode says; other
+	// searchers leave it nil.
+	ClassScores map[string]float64 `json:"class_scores,omitempty"`
+
+	// GroupKey is the doc-value of SearcherOptions.GroupBy for this hit, set
+	// when this DocumentMatch is the representative of a group emitted by a
+	// GroupingSearcher.
+	GroupKey string `json:"group_key,omitempty"`
+
+	// GroupHits holds the remaining top-scoring matches in this hit's group,
+	// up to SearcherOptions.GroupLimit, excluding the representative hit
+	// itself.
+	GroupHits []*DocumentMatch `json:"group_hits,omitempty"`
 }
 
 func (dm *DocumentMatch) AddFieldValue(name string, value interface{}) {
@@ -194,6 +211,19 @@ func (dm *DocumentMatch) SizeInBytes() int {
 		sizeInBytes += len(k) + index.SizeOfString + index.SizeOfInterface
 	}
 
+	// ClassScores
+	for k := range dm.ClassScores {
+		sizeInBytes += len(k) + index.SizeOfString + index.SizeOfFloat64
+	}
+
+	// GroupKey / GroupHits
+	sizeInBytes += len(dm.GroupKey)
+	for _, entry := range dm.GroupHits {
+		if entry != nil {
+			sizeInBytes += index.SizeOfPointer + entry.SizeInBytes()
+		}
+	}
+
 	// Document
 	if dm.Document != nil {
 		sizeInBytes += HeapOverhead["Document"] + int(dm.Document.NumPlainTextBytes()) +
@@ -226,6 +256,13 @@ func (c DocumentMatchCollection) SizeInBytes() int {
 }
 
 type Searcher interface {
+	// Next and Advance should return ctx.Ctx.Err() once ctx.Ctx has been
+	// cancelled or timed out, and should allocate any DocumentMatch they
+	// return via ctx.Allocate (plus ctx.ReserveExtra for any fields that grow
+	// it further) so it counts against ctx.MemTracker's budget, surfacing
+	// ErrSearchMemLimitExceeded in its place once that budget is exhausted. A
+	// DocumentMatch obtained from ctx.Allocate but discarded rather than
+	// returned to a caller should be given back with ctx.Recycle.
 	Next(ctx *SearchContext) (*DocumentMatch, error)
 	Advance(ctx *SearchContext, ID index.IndexInternalID) (*DocumentMatch, error)
 	Close() error
@@ -241,9 +278,95 @@ type Searcher interface {
 type SearcherOptions struct {
 	Explain            bool
 	IncludeTermVectors bool
+
+	// ClassificationMode marks a search as a classification search. No code
+	// in this package reads it: a ClassifierSearcher, built directly with
+	// NewClassifierSearcher, always fills DocumentMatch.Score with a log-odds
+	// classification score and DocumentMatch.ClassScores with the per-class
+	// posterior probabilities, and setting the flag does not change how any
+	// other searcher scores.
+	ClassificationMode bool
+
+	// GroupBy, when non-empty, names the doc-value field a GroupingSearcher
+	// collapses results on, emitting one representative DocumentMatch per
+	// distinct field value.
+	GroupBy string
+
+	// GroupLimit bounds how many top-scoring hits a GroupingSearcher buffers
+	// per group (surfaced via DocumentMatch.GroupHits). A value of 0 means
+	// only the representative hit is kept.
+	GroupLimit int
+
+	// TimeoutMillis is a time budget for the search, in milliseconds. No code
+	// in this package reads it or derives ctx.Ctx from it; searchers stop
+	// early only when ctx.Ctx is cancelled or its deadline passes.
+	TimeoutMillis int64
+
+	// ScoringModel names the TermScorer registered with RegisterScorer
+	// (e.g. "bm25") that ScorerForOptions returns. For an empty or
+	// unregistered name ScorerForOptions reports false. No searcher in this
+	// package calls ScorerForOptions.
+	ScoringModel string
+
+	// ScoringParams tunes the chosen ScoringModel, e.g. BM25's "k1" and "b".
+	ScoringParams map[string]float64
 }
 
 // SearchContext represents the context around a single search
 type SearchContext struct {
 	DocumentMatchPool *DocumentMatchPool
+	MemTracker        *MemTracker
+
+	// Ctx is checked by every Searcher's Next/Advance between postings
+	// iterations, so cancelling or timing it out stops the scan midway
+	// through. A nil Ctx is treated as never cancelled.
+	Ctx context.Context
+}
+
+// Allocate returns a *DocumentMatch from ctx.DocumentMatchPool, first
+// reserving its baseline heap overhead against ctx.MemTracker. Searchers
+// should call Allocate (rather than ctx.DocumentMatchPool.Get directly)
+// whenever they hand back a new DocumentMatch from Next/Advance, so the
+// reservation fails fast with ErrSearchMemLimitExceeded once the search's
+// memory budget is exhausted instead of allocating past it. Allocate only
+// covers the match's baseline shape; a searcher that goes on to populate
+// fields beyond that baseline (ClassScores, Locations, and the like) must
+// call ReserveExtra for the incremental bytes those fields add.
+func (ctx *SearchContext) Allocate() (*DocumentMatch, error) {
+	if ctx.MemTracker != nil {
+		if err := ctx.MemTracker.Reserve(uint64(HeapOverhead["DocumentMatch"])); err != nil {
+			return nil, err
+		}
+	}
+	return ctx.DocumentMatchPool.Get(), nil
+}
+
+// ReserveExtra accounts for delta additional bytes against ctx.MemTracker,
+// for a DocumentMatch already obtained from Allocate whose fields have since
+// grown it past its baseline heap overhead (e.g. a ClassifierSearcher
+// populating ClassScores). It is a no-op when ctx.MemTracker is nil.
+func (ctx *SearchContext) ReserveExtra(delta uint64) error {
+	if ctx.MemTracker == nil || delta == 0 {
+		return nil
+	}
+	return ctx.MemTracker.Reserve(delta)
+}
+
+// Recycle releases d's currently tracked memory back to ctx.MemTracker and
+// returns d to ctx.DocumentMatchPool for reuse. Searchers and collectors
+// that obtained d via Allocate but are discarding it without returning it to
+// a caller (e.g. a losing candidate evicted from a bounded buffer) should
+// call Recycle rather than letting it go, or ctx.MemTracker's usage will
+// only ever grow for the life of the search. It is a no-op for a nil
+// DocumentMatch.
+func (ctx *SearchContext) Recycle(d *DocumentMatch) {
+	if d == nil {
+		return
+	}
+	if ctx.MemTracker != nil {
+		ctx.MemTracker.Release(uint64(d.SizeInBytes()))
+	}
+	if ctx.DocumentMatchPool != nil {
+		ctx.DocumentMatchPool.Put(d)
+	}
 }
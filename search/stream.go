@@ -0,0 +1,45 @@
+//  Copyright (c) 2019 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import "context"
+
+// Stream drives s to completion, pushing each DocumentMatch onto out as it
+// is produced rather than materializing a full DocumentMatchCollection. This
+// lets callers pipe hits straight into highlighters, re-rankers or exporters
+// while still honoring cancellation.
+//
+// Stream respects back-pressure: a send to out blocks until the receiver is
+// ready or ctx is done, whichever comes first. Stream also hands ctx to s as
+// SearchContext.Ctx, so a Searcher that checks Ctx stops scanning once ctx
+// is cancelled or its deadline passes, not only Stream's sends.
+func Stream(ctx context.Context, s Searcher, out chan<- *DocumentMatch) error {
+	sctx := &SearchContext{
+		DocumentMatchPool: NewDocumentMatchPool(s.DocumentMatchPoolSize(), 0),
+		Ctx:               ctx,
+	}
+
+	match, err := s.Next(sctx)
+	for err == nil && match != nil {
+		select {
+		case out <- match:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		match, err = s.Next(sctx)
+	}
+	return err
+}
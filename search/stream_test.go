@@ -0,0 +1,77 @@
+//  Copyright (c) 2019 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"context"
+	"testing"
+
+	"github.com/blevesearch/bleve/index"
+)
+
+// stubSearcher yields a fixed number of matches and then stops.
+type stubSearcher struct {
+	remaining int
+}
+
+func (s *stubSearcher) Next(ctx *SearchContext) (*DocumentMatch, error) {
+	if s.remaining <= 0 {
+		return nil, nil
+	}
+	s.remaining--
+	return ctx.DocumentMatchPool.Get(), nil
+}
+
+func (s *stubSearcher) Advance(ctx *SearchContext, ID index.IndexInternalID) (*DocumentMatch, error) {
+	return s.Next(ctx)
+}
+
+func (s *stubSearcher) Close() error               { return nil }
+func (s *stubSearcher) Weight() float64            { return 1.0 }
+func (s *stubSearcher) SetQueryNorm(float64)       {}
+func (s *stubSearcher) Count() uint64              { return uint64(s.remaining) }
+func (s *stubSearcher) Min() int                   { return 0 }
+func (s *stubSearcher) SizeInBytes() int           { return 0 }
+func (s *stubSearcher) DocumentMatchPoolSize() int { return 1 }
+
+func TestStreamDeliversAllMatches(t *testing.T) {
+	s := &stubSearcher{remaining: 3}
+	out := make(chan *DocumentMatch, 3)
+
+	if err := Stream(context.Background(), s, out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	close(out)
+	var n int
+	for range out {
+		n++
+	}
+	if n != 3 {
+		t.Fatalf("expected 3 matches, got %d", n)
+	}
+}
+
+func TestStreamStopsOnCancellation(t *testing.T) {
+	s := &stubSearcher{remaining: 1000000}
+	out := make(chan *DocumentMatch) // unbuffered, so Stream blocks on send
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := Stream(ctx, s, out); err == nil {
+		t.Fatalf("expected an error once ctx is already cancelled")
+	}
+}